@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticator wraps the server's mux with pluggable authentication: basic
+// auth against an htpasswd file, static bearer tokens, or OIDC-issued JWTs.
+// Routes it decides not to protect (health checks, static UI assets) pass
+// through untouched.
+type Authenticator struct {
+	mode     string
+	basePath string
+
+	htpasswd *htpasswdFile
+	tokens   *tokenSet
+	oidc     *oidcVerifier
+}
+
+// NewAuthenticator builds an Authenticator from CLI flags. mode == "none"
+// returns a no-op authenticator.
+func NewAuthenticator(cfg Config, basePath string) (*Authenticator, error) {
+	a := &Authenticator{mode: cfg.AuthMode, basePath: basePath}
+
+	switch cfg.AuthMode {
+	case "", "none":
+		a.mode = "none"
+	case "basic":
+		if cfg.AuthHtpasswd == "" {
+			return nil, fmt.Errorf("--auth-mode=basic requires --auth-htpasswd")
+		}
+		h, err := newHtpasswdFile(cfg.AuthHtpasswd)
+		if err != nil {
+			return nil, err
+		}
+		a.htpasswd = h
+	case "bearer":
+		if cfg.AuthTokens == "" {
+			return nil, fmt.Errorf("--auth-mode=bearer requires --auth-tokens")
+		}
+		t, err := newTokenSet(cfg.AuthTokens)
+		if err != nil {
+			return nil, err
+		}
+		a.tokens = t
+	case "oidc":
+		if cfg.OIDCIssuer == "" || cfg.OIDCClientID == "" {
+			return nil, fmt.Errorf("--auth-mode=oidc requires --oidc-issuer and --oidc-client-id")
+		}
+		v, err := newOIDCVerifier(cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCAudience)
+		if err != nil {
+			return nil, err
+		}
+		a.oidc = v
+	default:
+		return nil, fmt.Errorf("unknown --auth-mode %q (want none, basic, bearer, or oidc)", cfg.AuthMode)
+	}
+	return a, nil
+}
+
+// Wrap protects routes that requiresAuth() flags, injecting an
+// X-TSUI-User header with the authenticated identity on success. Health
+// checks, the static UI/playground, and CORS preflight (OPTIONS) requests
+// are always left unauthenticated — browsers never attach credentials to
+// a preflight, and the route's own OPTIONS handling answers it.
+func (a *Authenticator) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || a.mode == "none" || !a.requiresAuth(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := a.authenticate(r)
+		if !ok {
+			if a.mode == "basic" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="TimeseriesUI"`)
+			}
+			jsonError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		r.Header.Set("X-TSUI-User", user)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Identify performs a best-effort, non-enforcing authentication check for
+// surfacing the current identity (e.g. to /api/mode) without gating the
+// route.
+func (a *Authenticator) Identify(r *http.Request) (string, bool) {
+	if a.mode == "none" {
+		return "", false
+	}
+	return a.authenticate(r)
+}
+
+// requiresAuth reports whether a request path must be authenticated:
+// proxy routes, the connections API, the native write/read API, the
+// per-target resilience state endpoint, and the legacy InfluxDB routes.
+// Health checks, /api/mode, and the static UI/playground are always open.
+func (a *Authenticator) requiresAuth(path string) bool {
+	rel := strings.TrimPrefix(path, a.basePath)
+	if strings.HasPrefix(rel, "/proxy/") {
+		return true
+	}
+	if rel == "/api/v1/connections" || strings.HasPrefix(rel, "/api/v1/connections/") {
+		return true
+	}
+	if rel == "/api/v1/write" || rel == "/api/v1/read" {
+		return true
+	}
+	if rel == "/api/v1/proxy/state" {
+		return true
+	}
+	for _, p := range []string{"/query", "/write", "/ping", "/debug/"} {
+		if rel == p || strings.HasPrefix(rel, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (string, bool) {
+	switch a.mode {
+	case "basic":
+		user, pass, ok := r.BasicAuth()
+		if !ok {
+			return "", false
+		}
+		if a.htpasswd.Verify(user, pass) {
+			return user, true
+		}
+		return "", false
+	case "bearer":
+		token := bearerToken(r)
+		if token == "" {
+			return "", false
+		}
+		return a.tokens.Verify(token)
+	case "oidc":
+		token := bearerToken(r)
+		if token == "" {
+			return "", false
+		}
+		claims, err := a.oidc.Verify(r.Context(), token)
+		if err != nil {
+			return "", false
+		}
+		return claims.Subject, true
+	default:
+		return "", false
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if !strings.HasPrefix(h, prefix) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(h, prefix))
+}
+
+// ── Basic auth: htpasswd file ───────────────────────────────────────────────
+
+// htpasswdFile holds user → hash entries parsed from an Apache-style
+// htpasswd file (bcrypt "$2y$"/"$2a$"/"$2b$" or legacy "{SHA}" lines),
+// reloaded whenever the file changes on disk.
+type htpasswdFile struct {
+	mu      sync.RWMutex
+	path    string
+	entries map[string]string
+}
+
+func newHtpasswdFile(path string) (*htpasswdFile, error) {
+	h := &htpasswdFile{path: path}
+	if err := h.reload(); err != nil {
+		return nil, err
+	}
+	h.watch()
+	return h, nil
+}
+
+func (h *htpasswdFile) reload() error {
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		return fmt.Errorf("reading htpasswd file %s: %w", h.path, err)
+	}
+	entries := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		entries[parts[0]] = parts[1]
+	}
+	h.mu.Lock()
+	h.entries = entries
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *htpasswdFile) watch() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		appLogger.Warnf("htpasswd file watcher unavailable: %v", err)
+		return
+	}
+	dir := "."
+	if idx := strings.LastIndex(h.path, "/"); idx >= 0 {
+		dir = h.path[:idx]
+	}
+	if err := watcher.Add(dir); err != nil {
+		appLogger.Warnf("htpasswd file watcher unavailable: %v", err)
+		watcher.Close()
+		return
+	}
+	go func() {
+		defer watcher.Close()
+		for event := range watcher.Events {
+			if filepath.Clean(event.Name) != filepath.Clean(h.path) || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if err := h.reload(); err != nil {
+				appLogger.Warnf("Failed to reload htpasswd file: %v", err)
+				continue
+			}
+			appLogger.Infof("Reloaded htpasswd file %s", h.path)
+		}
+	}()
+}
+
+func (h *htpasswdFile) Verify(user, password string) bool {
+	h.mu.RLock()
+	hash, ok := h.entries[user]
+	h.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	if strings.HasPrefix(hash, "{SHA}") {
+		sum := sha1.Sum([]byte(password))
+		expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+	}
+	return false
+}
+
+// ── Bearer auth: static token file ──────────────────────────────────────────
+
+// tokenSet holds SHA-256 digests of acceptable bearer tokens so the raw
+// tokens never sit in memory longer than needed and comparisons run in
+// constant time.
+type tokenSet struct {
+	mu      sync.RWMutex
+	path    string
+	digests map[[32]byte]string // digest → display name
+}
+
+func newTokenSet(path string) (*tokenSet, error) {
+	t := &tokenSet{path: path}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *tokenSet) reload() error {
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return fmt.Errorf("reading tokens file %s: %w", t.path, err)
+	}
+	digests := make(map[[32]byte]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, token := line, line
+		if idx := strings.Index(line, ":"); idx >= 0 {
+			name, token = line[:idx], line[idx+1:]
+		}
+		digests[sha256.Sum256([]byte(token))] = name
+	}
+	t.mu.Lock()
+	t.digests = digests
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *tokenSet) Verify(token string) (string, bool) {
+	sum := sha256.Sum256([]byte(token))
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for digest, name := range t.digests {
+		if subtle.ConstantTimeCompare(digest[:], sum[:]) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// ── OIDC: JWKS-validated bearer JWTs ────────────────────────────────────────
+
+type oidcDiscovery struct {
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// oidcHTTPTimeout bounds the discovery-document and JWKS fetches below, both
+// of which run synchronously during startup; without a timeout a
+// misconfigured or unreachable --oidc-issuer would hang the process
+// indefinitely before it ever starts listening.
+const oidcHTTPTimeout = 10 * time.Second
+
+var oidcHTTPClient = &http.Client{Timeout: oidcHTTPTimeout}
+
+// oidcVerifier validates RS256 JWTs against an issuer's JWKS, refreshing
+// the key set periodically so rotated signing keys are picked up without a
+// restart.
+type oidcVerifier struct {
+	issuer   string
+	clientID string
+	audience string
+	jwksURL  string
+
+	mu   sync.RWMutex
+	keys map[string]*rsa.PublicKey
+}
+
+func newOIDCVerifier(issuer, clientID, audience string) (*oidcVerifier, error) {
+	resp, err := oidcHTTPClient.Get(strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("fetching OIDC discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	var disc oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&disc); err != nil {
+		return nil, fmt.Errorf("parsing OIDC discovery document: %w", err)
+	}
+	if disc.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document for %s has no jwks_uri", issuer)
+	}
+
+	v := &oidcVerifier{issuer: issuer, clientID: clientID, audience: audience, jwksURL: disc.JWKSURI}
+	if err := v.refreshKeys(); err != nil {
+		return nil, err
+	}
+	go v.refreshLoop()
+	return v, nil
+}
+
+func (v *oidcVerifier) refreshLoop() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := v.refreshKeys(); err != nil {
+			appLogger.Warnf("Failed to refresh OIDC JWKS: %v", err)
+		}
+	}
+}
+
+func (v *oidcVerifier) refreshKeys() error {
+	resp, err := oidcHTTPClient.Get(v.jwksURL)
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	var set jwkSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		pub, err := rsaPublicKeyFromJWK(k)
+		if err != nil {
+			appLogger.Warnf("Skipping malformed JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+func rsaPublicKeyFromJWK(k jwk) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("decoding modulus: %w", err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("decoding exponent: %w", err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
+
+func (v *oidcVerifier) Verify(ctx context.Context, tokenString string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		v.mu.RLock()
+		key, ok := v.keys[kid]
+		v.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return key, nil
+	}, jwt.WithIssuer(v.issuer), jwt.WithAudience(v.audienceOrClientID()))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *oidcVerifier) audienceOrClientID() string {
+	if v.audience != "" {
+		return v.audience
+	}
+	return v.clientID
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// ── Response size limits ────────────────────────────────────────────────────
+
+// parseSize parses a human size string like "50MB", "512KB", or "100" (bytes)
+// into a byte count. Suffixes are matched case-insensitively; KB/MB/GB are
+// binary multiples (1024-based), matching how operators typically reason
+// about response buffers.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+	upper := strings.ToUpper(s)
+	multiplier := int64(1)
+	for _, suffix := range []struct {
+		name string
+		mult int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(upper, suffix.name) {
+			multiplier = suffix.mult
+			s = strings.TrimSpace(s[:len(s)-len(suffix.name)])
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("size must not be negative: %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// ── Upstream content-encoding handling ──────────────────────────────────────
+
+// decodeUpstreamBody unwraps a gzip or snappy-framed upstream body into a
+// plain io.ReadCloser. InfluxDB and Prometheus remote-read responses are
+// frequently snappy-framed; VictoriaMetrics and most REST APIs use gzip or
+// send identity. Closing the returned reader also closes resp.Body.
+func decodeUpstreamBody(resp *http.Response) (io.ReadCloser, error) {
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		return readCloser{gz, resp.Body}, nil
+	case "snappy", "x-snappy":
+		return readCloser{snappy.NewReader(resp.Body), resp.Body}, nil
+	default:
+		return resp.Body, nil
+	}
+}
+
+// readCloser pairs a decoding Reader with the underlying Closer it reads from.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// writeProxiedResponse copies an upstream response to the client, enforcing
+// maxBytes and re-encoding the body to satisfy the client's Accept-Encoding.
+// The whole body is buffered (bounded by maxBytes+1) so an over-limit
+// response can still be reported as a structured 413 instead of a truncated
+// stream with headers already sent.
+func writeProxiedResponse(w http.ResponseWriter, r *http.Request, resp *http.Response, maxBytes int64) {
+	decoded, err := decodeUpstreamBody(resp)
+	if err != nil {
+		jsonError(w, http.StatusBadGateway, fmt.Sprintf("Failed to decode upstream response: %s", err))
+		return
+	}
+	defer decoded.Close()
+
+	body, err := io.ReadAll(io.LimitReader(decoded, maxBytes+1))
+	if err != nil {
+		jsonError(w, http.StatusBadGateway, fmt.Sprintf("Failed to read upstream response: %s", err))
+		return
+	}
+	if int64(len(body)) > maxBytes {
+		jsonError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upstream response exceeds the %d byte limit", maxBytes))
+		return
+	}
+
+	for k, vs := range resp.Header {
+		if k == "Content-Encoding" || k == "Content-Length" {
+			continue
+		}
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	setCORS(w)
+
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(resp.StatusCode)
+		gz := gzip.NewWriter(w)
+		gz.Write(body)
+		gz.Close()
+		return
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// errConnectionNotFound is returned by ConnectionStore.Update/Delete when the
+// requested ID doesn't exist.
+var errConnectionNotFound = errors.New("connection not found")
+
+// ConnectionStore manages the server-side list of connections: CRUD over
+// HTTP, encrypted persistence to disk, live reload when the backing file
+// changes out-of-band (e.g. a hand-edited JSON file), and SSE push to
+// connected UIs.
+type ConnectionStore struct {
+	mu       sync.RWMutex
+	path     string
+	key      []byte
+	readOnly bool
+	conns    []CLIConnection
+	// lastWritten is the hash of the file content this store last wrote via
+	// persistLocked, so Watch can tell its own save apart from an external
+	// edit and skip reloading what it just persisted.
+	lastWritten [32]byte
+
+	subMu sync.Mutex
+	subs  map[chan []CLIConnection]struct{}
+}
+
+// NewConnectionStore loads the store at path, or initializes it (seeded with
+// seed, typically the connections derived from CLI flags) if the file
+// doesn't exist yet.
+func NewConnectionStore(path string, keyFile string, readOnly bool, seed []CLIConnection) (*ConnectionStore, error) {
+	key, err := loadOrCreateConnectionsKey(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("connections encryption key: %w", err)
+	}
+	s := &ConnectionStore{
+		path:     path,
+		key:      key,
+		readOnly: readOnly,
+		subs:     make(map[chan []CLIConnection]struct{}),
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		s.conns = append([]CLIConnection{}, seed...)
+		for i := range s.conns {
+			if s.conns[i].ID == "" {
+				s.conns[i].ID = generateConnectionID()
+			}
+		}
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *ConnectionStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("reading connections store: %w", err)
+	}
+	var cf ConnectionsFile
+	if err := json.Unmarshal(data, &cf); err != nil {
+		return fmt.Errorf("parsing connections store: %w", err)
+	}
+	for i := range cf.Connections {
+		if cf.Connections[i].ID == "" {
+			cf.Connections[i].ID = generateConnectionID()
+		}
+		cf.Connections[i].Source = "cli"
+		if err := s.decryptSecrets(&cf.Connections[i]); err != nil {
+			return fmt.Errorf("decrypting connection %q: %w", cf.Connections[i].Name, err)
+		}
+	}
+	s.mu.Lock()
+	s.conns = cf.Connections
+	s.mu.Unlock()
+	return nil
+}
+
+// persistLocked atomically rewrites the store file with secrets encrypted
+// at rest. Callers must hold s.mu for writing, across both their mutation
+// of s.conns and this call, so a concurrent reload from Watch can never
+// land between the mutation and the write and overwrite it in memory.
+func (s *ConnectionStore) persistLocked() error {
+	out := make([]CLIConnection, len(s.conns))
+	copy(out, s.conns)
+
+	for i := range out {
+		if err := s.encryptSecrets(&out[i]); err != nil {
+			return fmt.Errorf("encrypting connection %q: %w", out[i].Name, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(ConnectionsFile{Connections: out}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".connections-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.lastWritten = sha256.Sum256(data)
+	return nil
+}
+
+// save acquires s.mu and persists the current connections. Used where the
+// caller hasn't already mutated s.conns under lock (e.g. initial seeding);
+// Create/Update/Delete call persistLocked directly while still holding the
+// lock they mutated under.
+func (s *ConnectionStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.persistLocked()
+}
+
+// List returns a snapshot of the current connections.
+func (s *ConnectionStore) List() []CLIConnection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]CLIConnection, len(s.conns))
+	copy(out, s.conns)
+	return out
+}
+
+// Create appends a new connection, persists the store, and notifies SSE
+// subscribers.
+func (s *ConnectionStore) Create(c CLIConnection) (CLIConnection, error) {
+	c.ID = generateConnectionID()
+	c.Source = "cli"
+	s.mu.Lock()
+	s.conns = append(s.conns, c)
+	err := s.persistLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return CLIConnection{}, err
+	}
+	s.notify()
+	return c, nil
+}
+
+// Update replaces the connection with the given id, persists the store, and
+// notifies SSE subscribers.
+func (s *ConnectionStore) Update(id string, c CLIConnection) (CLIConnection, error) {
+	s.mu.Lock()
+	idx := indexByID(s.conns, id)
+	if idx == -1 {
+		s.mu.Unlock()
+		return CLIConnection{}, errConnectionNotFound
+	}
+	c.ID = id
+	c.Source = "cli"
+	s.conns[idx] = c
+	err := s.persistLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return CLIConnection{}, err
+	}
+	s.notify()
+	return c, nil
+}
+
+// Delete removes the connection with the given id, persists the store, and
+// notifies SSE subscribers.
+func (s *ConnectionStore) Delete(id string) error {
+	s.mu.Lock()
+	idx := indexByID(s.conns, id)
+	if idx == -1 {
+		s.mu.Unlock()
+		return errConnectionNotFound
+	}
+	s.conns = append(s.conns[:idx], s.conns[idx+1:]...)
+	err := s.persistLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+func indexByID(conns []CLIConnection, id string) int {
+	for i, c := range conns {
+		if c.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ── SSE fan-out ──────────────────────────────────────────────────────────────
+
+// Subscribe registers a channel that receives the full connection list
+// whenever it changes. Callers must Unsubscribe when done.
+func (s *ConnectionStore) Subscribe() chan []CLIConnection {
+	ch := make(chan []CLIConnection, 1)
+	s.subMu.Lock()
+	s.subs[ch] = struct{}{}
+	s.subMu.Unlock()
+	return ch
+}
+
+// Unsubscribe removes and closes a channel returned by Subscribe.
+func (s *ConnectionStore) Unsubscribe(ch chan []CLIConnection) {
+	s.subMu.Lock()
+	delete(s.subs, ch)
+	s.subMu.Unlock()
+	close(ch)
+}
+
+func (s *ConnectionStore) notify() {
+	conns := s.List()
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for ch := range s.subs {
+		select {
+		case ch <- conns:
+		default:
+			// Slow subscriber — drop the stale update, the next one will catch up.
+		}
+	}
+}
+
+// ── File watcher (out-of-band edits) ────────────────────────────────────────
+
+// Watch starts a background fsnotify watcher that reloads the store whenever
+// its backing file is edited outside the API (e.g. by hand or config
+// management), pushing the refreshed list to SSE subscribers. Writes made by
+// this store itself (Create/Update/Delete/save) are recognized by content
+// hash and skipped, since they land in the same watched directory.
+func (s *ConnectionStore) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(s.path) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if data, err := os.ReadFile(s.path); err == nil {
+					s.mu.RLock()
+					selfWrite := sha256.Sum256(data) == s.lastWritten
+					s.mu.RUnlock()
+					if selfWrite {
+						continue
+					}
+				}
+				if err := s.load(); err != nil {
+					appLogger.Errorf("Connections store: failed to reload after external edit: %v", err)
+					continue
+				}
+				appLogger.Infof("Connections store: reloaded after external edit to %s", s.path)
+				s.notify()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				appLogger.Errorf("Connections store: watcher error: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// ── HTTP routes ──────────────────────────────────────────────────────────────
+
+// RegisterRoutes wires the store's REST CRUD + SSE endpoints into mux.
+func (s *ConnectionStore) RegisterRoutes(mux *http.ServeMux, basePath string) {
+	collection := basePath + "/api/v1/connections"
+	member := collection + "/"
+
+	mux.HandleFunc(collection, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		setCORS(w)
+		switch r.Method {
+		case http.MethodOptions:
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(s.List())
+		case http.MethodPost:
+			if s.readOnly {
+				jsonError(w, http.StatusForbidden, "Connection management is disabled")
+				return
+			}
+			var c CLIConnection
+			if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+				jsonError(w, http.StatusBadRequest, fmt.Sprintf("Invalid connection payload: %s", err))
+				return
+			}
+			created, err := s.Create(c)
+			if err != nil {
+				jsonError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save connection: %s", err))
+				return
+			}
+			json.NewEncoder(w).Encode(created)
+		default:
+			jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	})
+
+	mux.HandleFunc(member, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		setCORS(w)
+		id := strings.TrimPrefix(r.URL.Path, member)
+		if id == "" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodOptions:
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodPut:
+			if s.readOnly {
+				jsonError(w, http.StatusForbidden, "Connection management is disabled")
+				return
+			}
+			var c CLIConnection
+			if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+				jsonError(w, http.StatusBadRequest, fmt.Sprintf("Invalid connection payload: %s", err))
+				return
+			}
+			updated, err := s.Update(id, c)
+			if errors.Is(err, errConnectionNotFound) {
+				jsonError(w, http.StatusNotFound, "Connection not found")
+				return
+			} else if err != nil {
+				jsonError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save connection: %s", err))
+				return
+			}
+			json.NewEncoder(w).Encode(updated)
+		case http.MethodDelete:
+			if s.readOnly {
+				jsonError(w, http.StatusForbidden, "Connection management is disabled")
+				return
+			}
+			err := s.Delete(id)
+			if errors.Is(err, errConnectionNotFound) {
+				jsonError(w, http.StatusNotFound, "Connection not found")
+				return
+			} else if err != nil {
+				jsonError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete connection: %s", err))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	})
+
+	mux.HandleFunc(collection+"/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			jsonError(w, http.StatusInternalServerError, "Streaming unsupported")
+			return
+		}
+		setCORS(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		ch := s.Subscribe()
+		defer s.Unsubscribe(ch)
+
+		writeConnectionsSSE(w, s.List())
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case conns := <-ch:
+				writeConnectionsSSE(w, conns)
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+func writeConnectionsSSE(w http.ResponseWriter, conns []CLIConnection) {
+	data, err := json.Marshal(conns)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: connections\ndata: %s\n\n", data)
+}
+
+// ── Secrets at rest (AES-256-GCM) ────────────────────────────────────────────
+
+func loadOrCreateConnectionsKey(path string) ([]byte, error) {
+	if path == "" {
+		path = "connections.key"
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		key, decErr := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if decErr != nil {
+			return nil, fmt.Errorf("invalid key file %s: %w", path, decErr)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key file %s must contain a 32-byte key, got %d bytes", path, len(key))
+		}
+		return key, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("writing new key file %s: %w", path, err)
+	}
+	appLogger.Infof("Generated new connections encryption key at %s", path)
+	return key, nil
+}
+
+// encSecretPrefix marks a field value as AES-GCM ciphertext, distinguishing
+// it from plaintext carried over from a pre-encryption connections file.
+const encSecretPrefix = "enc:"
+
+func encryptSecret(key []byte, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encSecretPrefix + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func decryptSecret(key []byte, stored string) (string, error) {
+	if stored == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(stored, encSecretPrefix) {
+		// Plaintext carried over from a pre-encryption connections file.
+		return stored, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encSecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+	nonce, ct := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ct, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func (s *ConnectionStore) encryptSecrets(c *CLIConnection) error {
+	v, err := encryptSecret(s.key, c.Password)
+	if err != nil {
+		return err
+	}
+	c.Password = v
+	v, err = encryptSecret(s.key, c.AlertmanagerPassword)
+	if err != nil {
+		return err
+	}
+	c.AlertmanagerPassword = v
+	return nil
+}
+
+func (s *ConnectionStore) decryptSecrets(c *CLIConnection) error {
+	v, err := decryptSecret(s.key, c.Password)
+	if err != nil {
+		return err
+	}
+	c.Password = v
+	v, err = decryptSecret(s.key, c.AlertmanagerPassword)
+	if err != nil {
+		return err
+	}
+	c.AlertmanagerPassword = v
+	return nil
+}
+
+func generateConnectionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ── Store path resolution ────────────────────────────────────────────────────
+
+// resolveConnectionsStorePath picks the file the store persists to: the
+// explicit --connections file if set, otherwise connections.json inside
+// --connections-store (or the working directory if neither is set).
+func resolveConnectionsStorePath(cfg Config) string {
+	if cfg.ConnectionsFile != "" {
+		return cfg.ConnectionsFile
+	}
+	if cfg.ConnectionsStoreDir != "" {
+		return filepath.Join(cfg.ConnectionsStoreDir, "connections.json")
+	}
+	return "connections.json"
+}
+
+// resolveConnectionsKeyFile picks the encryption key file: the explicit
+// --connections-key-file if set, otherwise a sibling of the store file.
+func resolveConnectionsKeyFile(cfg Config) string {
+	if cfg.ConnectionsKeyFile != "" {
+		return cfg.ConnectionsKeyFile
+	}
+	return resolveConnectionsStorePath(cfg) + ".key"
+}
@@ -14,6 +14,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"flag"
@@ -49,6 +50,7 @@ func (s *stringSlice) Set(v string) error {
 // ── Connection model ────────────────────────────────────────────────────────
 
 type CLIConnection struct {
+	ID                   string `json:"id,omitempty"`
 	Name                 string `json:"name"`
 	Type                 string `json:"type"` // "influxdb", "prometheus", or "victoriametrics"
 	URL                  string `json:"url"`
@@ -72,21 +74,34 @@ type ConnectionsFile struct {
 // ── Config ──────────────────────────────────────────────────────────────────
 
 type Config struct {
-	Port            int
-	Host            string
-	BasePath        string
-	TLSCert         string
-	TLSKey          string
-	LogLevel        string
-	LogFormat       string
-	ProxyTimeout    time.Duration
-	MaxResponseSize string
-	DisableWrite    bool
-	DisableAdmin    bool
-	ReadOnly        bool
-	ShowVersion     bool
-	ConnectionsFile string
-	Connections     []CLIConnection
+	Port                 int
+	Host                 string
+	BasePath             string
+	TLSCert              string
+	TLSKey               string
+	LogLevel             string
+	LogFormat            string
+	ProxyTimeout         time.Duration
+	MaxResponseSize      string
+	MaxResponseSizeBytes int64
+	DisableWrite         bool
+	DisableAdmin         bool
+	ReadOnly             bool
+	ShowVersion          bool
+	ConnectionsFile      string
+	ConnectionsStoreDir  string
+	ConnectionsKeyFile   string
+	Connections          []CLIConnection
+	MetricsListen        string
+	ProxyRPS             float64
+	ProxyBurst           int
+
+	AuthMode     string
+	AuthHtpasswd string
+	AuthTokens   string
+	OIDCIssuer   string
+	OIDCClientID string
+	OIDCAudience string
 }
 
 func main() {
@@ -109,6 +124,12 @@ func main() {
 	}
 
 	basePath := strings.TrimRight(cfg.BasePath, "/")
+	appLogger = NewLogger(cfg.LogLevel, cfg.LogFormat)
+
+	authn, err := NewAuthenticator(cfg, basePath)
+	if err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
 
 	mux := http.NewServeMux()
 
@@ -116,23 +137,27 @@ func main() {
 	mux.HandleFunc(basePath+"/api/mode", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		resp := map[string]interface{}{
-			"mode":         "standalone",
-			"disableWrite": cfg.DisableWrite || cfg.ReadOnly,
-			"disableAdmin": cfg.DisableAdmin || cfg.ReadOnly,
+			"mode":            "standalone",
+			"disableWrite":    cfg.DisableWrite || cfg.ReadOnly,
+			"disableAdmin":    cfg.DisableAdmin || cfg.ReadOnly,
+			"maxResponseSize": cfg.MaxResponseSizeBytes,
+			"authMode":        cfg.AuthMode,
+		}
+		if user, ok := authn.Identify(r); ok {
+			resp["user"] = user
 		}
 		json.NewEncoder(w).Encode(resp)
 	})
 
-	// ── API: CLI-provided connections ───────────────────────────────────
-	mux.HandleFunc(basePath+"/api/v1/connections", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		setCORS(w)
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		json.NewEncoder(w).Encode(cfg.Connections)
-	})
+	// ── API: connections (CRUD + SSE, backed by an encrypted store) ─────
+	store, err := NewConnectionStore(resolveConnectionsStorePath(cfg), resolveConnectionsKeyFile(cfg), cfg.DisableAdmin || cfg.ReadOnly, cfg.Connections)
+	if err != nil {
+		log.Fatalf("Failed to initialize connections store: %v", err)
+	}
+	if err := store.Watch(context.Background()); err != nil {
+		appLogger.Warnf("Connections file watcher unavailable: %v", err)
+	}
+	store.RegisterRoutes(mux, basePath)
 
 	// ── API: health check ──────────────────────────────────────────────
 	mux.HandleFunc(basePath+"/api/v1/health", func(w http.ResponseWriter, r *http.Request) {
@@ -143,22 +168,36 @@ func main() {
 		})
 	})
 
+	// ── Resilience: per-target rate limiting, circuit breaking, retries ──
+	resilience := NewResilienceRegistry(cfg.ProxyRPS, float64(cfg.ProxyBurst))
+	mux.HandleFunc(basePath+"/api/v1/proxy/state", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resilience.Snapshot())
+	})
+
 	// ── Generic proxies ─────────────────────────────────────────────────
-	mux.HandleFunc(basePath+"/proxy/influxdb/", makeGenericProxy(httpClient))
-	mux.HandleFunc(basePath+"/proxy/prometheus/", makeGenericProxy(httpClient))
-	mux.HandleFunc(basePath+"/proxy/alertmanager/", makeGenericProxy(httpClient))
-	mux.HandleFunc(basePath+"/proxy/victoriametrics/", makeGenericProxy(httpClient))
+	mux.HandleFunc(basePath+"/proxy/influxdb/", instrumentProxy("influxdb", makeGenericProxy(httpClient, cfg.MaxResponseSizeBytes, resilience, "influxdb")))
+	mux.HandleFunc(basePath+"/proxy/prometheus/", instrumentProxy("prometheus", makeGenericProxy(httpClient, cfg.MaxResponseSizeBytes, resilience, "prometheus")))
+	mux.HandleFunc(basePath+"/proxy/alertmanager/", instrumentProxy("alertmanager", makeGenericProxy(httpClient, cfg.MaxResponseSizeBytes, resilience, "alertmanager")))
+	mux.HandleFunc(basePath+"/proxy/victoriametrics/", instrumentProxy("victoriametrics", makeGenericProxy(httpClient, cfg.MaxResponseSizeBytes, resilience, "victoriametrics")))
+
+	// ── Native write/read: first-class translation instead of opaque proxying ──
+	mux.HandleFunc(basePath+"/api/v1/write", instrumentProxy("write", makeRemoteWriteHandler(httpClient, store, resilience, cfg.DisableWrite || cfg.ReadOnly, cfg.MaxResponseSizeBytes)))
+	mux.HandleFunc(basePath+"/api/v1/read", instrumentProxy("read", makeRemoteReadHandler(httpClient, store, resilience, cfg.MaxResponseSizeBytes)))
+
+	// ── Observability ────────────────────────────────────────────────────
+	registerMetricsRoute(mux, basePath, cfg.MetricsListen)
 
 	// ── Legacy InfluxDB proxy (backward compatibility) ──────────────────
 	defaultInfluxURL := ""
-	for _, c := range cfg.Connections {
+	for _, c := range store.List() {
 		if c.Type == "influxdb" {
 			defaultInfluxURL = c.URL
 			break
 		}
 	}
 	for _, p := range []string{"/query", "/write", "/ping", "/debug/"} {
-		mux.HandleFunc(basePath+p, makeLegacyInfluxProxy(httpClient, defaultInfluxURL, basePath))
+		mux.HandleFunc(basePath+p, instrumentProxy("influxdb-legacy", makeLegacyInfluxProxy(httpClient, defaultInfluxURL, basePath, cfg.MaxResponseSizeBytes, resilience)))
 	}
 
 	// ── Serve the embedded SPA ──────────────────────────────────────────
@@ -203,8 +242,8 @@ func main() {
 	}
 	fmt.Printf("TimeseriesUI %s starting on %s://%s:%d%s/ui/\n", Version, scheme, displayHost, cfg.Port, basePath)
 	fmt.Printf("Playground available at %s://%s:%d%s/playground/\n", scheme, displayHost, cfg.Port, basePath)
-	if len(cfg.Connections) > 0 {
-		for _, c := range cfg.Connections {
+	if conns := store.List(); len(conns) > 0 {
+		for _, c := range conns {
 			fmt.Printf("  [%s] %s → %s\n", c.Type, c.Name, c.URL)
 		}
 	} else {
@@ -212,12 +251,13 @@ func main() {
 	}
 	fmt.Println("Press Ctrl+C to stop.")
 
+	handler := authn.Wrap(mux)
 	if cfg.TLSCert != "" && cfg.TLSKey != "" {
-		if err := http.ListenAndServeTLS(addr, cfg.TLSCert, cfg.TLSKey, mux); err != nil {
+		if err := http.ListenAndServeTLS(addr, cfg.TLSCert, cfg.TLSKey, handler); err != nil {
 			log.Fatalf("Server failed: %v", err)
 		}
 	} else {
-		if err := http.ListenAndServe(addr, mux); err != nil {
+		if err := http.ListenAndServe(addr, handler); err != nil {
 			log.Fatalf("Server failed: %v", err)
 		}
 	}
@@ -269,8 +309,13 @@ func parseFlags() Config {
 	flag.StringVar(&vmTenant, "vm-tenant", "", "Tenant ID for VictoriaMetrics cluster mode (e.g. 0 or 0:0)")
 
 	flag.StringVar(&cfg.ConnectionsFile, "connections", "", "Path to a JSON connections file")
+	flag.StringVar(&cfg.ConnectionsStoreDir, "connections-store", "", "Directory to persist a connections.json store in (ignored if --connections is set)")
+	flag.StringVar(&cfg.ConnectionsKeyFile, "connections-key-file", "", "Path to the AES-256 key used to encrypt connection secrets at rest (generated on first run if missing)")
 	flag.StringVar(&cfg.LogLevel, "log-level", "info", "Log verbosity: debug, info, warn, error")
 	flag.StringVar(&cfg.LogFormat, "log-format", "text", "Log format: text, json")
+	flag.StringVar(&cfg.MetricsListen, "metrics-listen", "", "Bind /metrics to a separate admin address (e.g. :9100) instead of the public listener")
+	flag.Float64Var(&cfg.ProxyRPS, "proxy-rps", 0, "Max requests/sec per (backend, target host); 0 disables rate limiting")
+	flag.IntVar(&cfg.ProxyBurst, "proxy-burst", 20, "Token-bucket burst capacity for --proxy-rps")
 	flag.StringVar(&proxyTimeout, "proxy-timeout", "30s", "Timeout for proxied API requests")
 	flag.StringVar(&cfg.MaxResponseSize, "max-response-size", "50MB", "Max proxied response size")
 
@@ -279,6 +324,13 @@ func parseFlags() Config {
 	flag.BoolVar(&cfg.ReadOnly, "readonly", false, "Shorthand for --disable-write --disable-admin")
 	flag.BoolVar(&cfg.ShowVersion, "version", false, "Print version and exit")
 
+	flag.StringVar(&cfg.AuthMode, "auth-mode", "none", "Authentication mode: none, basic, bearer, or oidc")
+	flag.StringVar(&cfg.AuthHtpasswd, "auth-htpasswd", "", "Path to an htpasswd file (bcrypt or {SHA}) for --auth-mode=basic, watched for changes")
+	flag.StringVar(&cfg.AuthTokens, "auth-tokens", "", "Path to a line-delimited bearer token file for --auth-mode=bearer")
+	flag.StringVar(&cfg.OIDCIssuer, "oidc-issuer", "", "OIDC issuer URL for --auth-mode=oidc (used for discovery and issuer validation)")
+	flag.StringVar(&cfg.OIDCClientID, "oidc-client-id", "", "OIDC client ID; also used as the expected audience if --oidc-audience is unset")
+	flag.StringVar(&cfg.OIDCAudience, "oidc-audience", "", "Expected JWT audience for --auth-mode=oidc (defaults to --oidc-client-id)")
+
 	flag.Parse()
 
 	if d, err := time.ParseDuration(proxyTimeout); err == nil {
@@ -287,6 +339,13 @@ func parseFlags() Config {
 		cfg.ProxyTimeout = 30 * time.Second
 	}
 
+	if n, err := parseSize(cfg.MaxResponseSize); err == nil {
+		cfg.MaxResponseSizeBytes = n
+	} else {
+		appLogger.Warnf("Invalid --max-response-size %q (%v); defaulting to 50MB", cfg.MaxResponseSize, err)
+		cfg.MaxResponseSizeBytes = 50 << 20
+	}
+
 	// Load connections file if provided
 	if cfg.ConnectionsFile != "" {
 		data, err := os.ReadFile(cfg.ConnectionsFile)
@@ -377,7 +436,7 @@ func parseFlags() Config {
 	}
 
 	if amURL != "" && len(promURLs) == 0 && len(vmURLs) == 0 {
-		log.Println("Warning: --alertmanager-url specified without --prometheus-url or --vm-url; it won't be used.")
+		appLogger.Warnf("--alertmanager-url specified without --prometheus-url or --vm-url; it won't be used.")
 	}
 
 	return cfg
@@ -397,7 +456,7 @@ func nameFromURL(rawURL, backendType string) string {
 
 // ── Generic Proxy Handler ───────────────────────────────────────────────────
 
-func makeGenericProxy(httpClient *http.Client) http.HandlerFunc {
+func makeGenericProxy(httpClient *http.Client, maxResponseSize int64, resilience *ResilienceRegistry, backend string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		setCORS(w)
 		if r.Method == http.MethodOptions {
@@ -458,27 +517,20 @@ func makeGenericProxy(httpClient *http.Client) http.HandlerFunc {
 			proxyReq.SetBasicAuth(username, password)
 		}
 
-		resp, err := httpClient.Do(proxyReq)
+		resp, err := resilience.Do(httpClient, backend, proxyReq)
 		if err != nil {
-			jsonError(w, http.StatusBadGateway, fmt.Sprintf("Connection failed: %s", err))
+			writeResilienceError(w, err, resilience, backend, parsedTarget.Hostname())
 			return
 		}
 		defer resp.Body.Close()
 
-		for k, vs := range resp.Header {
-			for _, v := range vs {
-				w.Header().Add(k, v)
-			}
-		}
-		setCORS(w)
-		w.WriteHeader(resp.StatusCode)
-		io.Copy(w, resp.Body)
+		writeProxiedResponse(w, r, resp, maxResponseSize)
 	}
 }
 
 // ── Legacy InfluxDB Proxy (backward compat) ─────────────────────────────────
 
-func makeLegacyInfluxProxy(httpClient *http.Client, defaultURL string, basePath string) http.HandlerFunc {
+func makeLegacyInfluxProxy(httpClient *http.Client, defaultURL string, basePath string, maxResponseSize int64, resilience *ResilienceRegistry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		setCORS(w)
 		if r.Method == http.MethodOptions {
@@ -533,21 +585,14 @@ func makeLegacyInfluxProxy(httpClient *http.Client, defaultURL string, basePath
 			}
 		}
 
-		resp, err := httpClient.Do(proxyReq)
+		resp, err := resilience.Do(httpClient, "influxdb-legacy", proxyReq)
 		if err != nil {
-			jsonError(w, http.StatusBadGateway, fmt.Sprintf("Connection failed: %s", err))
+			writeResilienceError(w, err, resilience, "influxdb-legacy", target.Hostname())
 			return
 		}
 		defer resp.Body.Close()
 
-		for k, vs := range resp.Header {
-			for _, v := range vs {
-				w.Header().Add(k, v)
-			}
-		}
-		setCORS(w)
-		w.WriteHeader(resp.StatusCode)
-		io.Copy(w, resp.Body)
+		writeProxiedResponse(w, r, resp, maxResponseSize)
 	}
 }
 
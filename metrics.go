@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ── Prometheus metrics ───────────────────────────────────────────────────────
+
+var (
+	proxyRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsui_proxy_requests_total",
+		Help: "Total proxied requests, labeled by backend, HTTP status code, and method.",
+	}, []string{"backend", "code", "method"})
+
+	proxyDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tsui_proxy_duration_seconds",
+		Help:    "Latency of proxied requests, labeled by backend.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"backend"})
+
+	proxyUpstreamFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsui_proxy_upstream_failures_total",
+		Help: "Proxied requests that failed to reach the upstream backend.",
+	}, []string{"backend"})
+
+	proxyInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tsui_proxy_in_flight_requests",
+		Help: "Proxied requests currently in flight, labeled by backend.",
+	}, []string{"backend"})
+
+	proxyResponseSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tsui_proxy_response_size_bytes",
+		Help:    "Size of proxied upstream response bodies, labeled by backend.",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+	}, []string{"backend"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		proxyRequestsTotal,
+		proxyDurationSeconds,
+		proxyUpstreamFailuresTotal,
+		proxyInFlight,
+		proxyResponseSizeBytes,
+	)
+}
+
+// registerMetricsRoute exposes the promhttp handler either on the public mux
+// at basePath+"/metrics", or on a separate admin listener when
+// --metrics-listen is set (keeping it off the public-facing port).
+func registerMetricsRoute(mux *http.ServeMux, basePath string, metricsListen string) {
+	if metricsListen == "" {
+		mux.Handle(basePath+"/metrics", promhttp.Handler())
+		return
+	}
+	go func() {
+		admin := http.NewServeMux()
+		admin.Handle("/metrics", promhttp.Handler())
+		appLogger.Infof("Metrics listening on %s/metrics", metricsListen)
+		if err := http.ListenAndServe(metricsListen, admin); err != nil {
+			appLogger.Errorf("Metrics listener failed: %v", err)
+		}
+	}()
+}
+
+// ── Request instrumentation ──────────────────────────────────────────────────
+
+// statusRecorder captures the status code and byte count a handler wrote, so
+// instrumentProxy can report them after the fact without the wrapped handler
+// needing to know it's being observed.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// instrumentProxy wraps a proxy handler with Prometheus metrics and
+// structured request logging, shared by both the generic and legacy
+// InfluxDB proxies.
+func instrumentProxy(backend string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := generateRequestID()
+		w.Header().Set("X-Request-ID", requestID)
+
+		proxyInFlight.WithLabelValues(backend).Inc()
+		defer proxyInFlight.WithLabelValues(backend).Dec()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next(rec, r)
+		duration := time.Since(start)
+
+		proxyRequestsTotal.WithLabelValues(backend, strconv.Itoa(rec.status), r.Method).Inc()
+		proxyDurationSeconds.WithLabelValues(backend).Observe(duration.Seconds())
+		proxyResponseSizeBytes.WithLabelValues(backend).Observe(float64(rec.bytes))
+		if rec.status == http.StatusBadGateway {
+			proxyUpstreamFailuresTotal.WithLabelValues(backend).Inc()
+		}
+
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			target = r.Header.Get("X-Influxdb-Url")
+		}
+		appLogger.LogRequest(RequestLog{
+			RequestID: requestID,
+			Backend:   backend,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Target:    target,
+			Status:    rec.status,
+			Bytes:     rec.bytes,
+			Duration:  duration,
+		})
+	}
+}
+
+func generateRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ── Structured logger ────────────────────────────────────────────────────────
+
+// appLogger is the process-wide structured logger, reconfigured from
+// --log-level/--log-format at startup. Package-level so code that logs
+// operational events (the connections store, auth subsystem, proxies)
+// doesn't need the logger threaded through every constructor.
+var appLogger = NewLogger("info", "text")
+
+var logLevelRank = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// Logger is a minimal leveled logger supporting plain text or single-line
+// JSON output, selected via --log-format.
+type Logger struct {
+	level  string
+	format string
+}
+
+// NewLogger builds a Logger from --log-level/--log-format values, falling
+// back to "info"/"text" for anything unrecognized.
+func NewLogger(level, format string) *Logger {
+	level = strings.ToLower(level)
+	if _, ok := logLevelRank[level]; !ok {
+		level = "info"
+	}
+	format = strings.ToLower(format)
+	if format != "json" {
+		format = "text"
+	}
+	return &Logger{level: level, format: format}
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) { l.logf("debug", format, args...) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.logf("info", format, args...) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.logf("warn", format, args...) }
+func (l *Logger) Errorf(format string, args ...interface{}) { l.logf("error", format, args...) }
+
+func (l *Logger) logf(level, format string, args ...interface{}) {
+	if logLevelRank[level] < logLevelRank[l.level] {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if l.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"time":  time.Now().Format(time.RFC3339),
+			"level": level,
+			"msg":   msg,
+		})
+		fmt.Fprintln(os.Stdout, string(data))
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s [%s] %s\n", time.Now().Format(time.RFC3339), strings.ToUpper(level), msg)
+}
+
+// RequestLog describes one proxied request, emitted after the response has
+// been written.
+type RequestLog struct {
+	RequestID string
+	Backend   string
+	Method    string
+	Path      string
+	Target    string
+	Status    int
+	Bytes     int
+	Duration  time.Duration
+}
+
+// LogRequest emits a single structured info-level line per proxied request,
+// honoring --log-format.
+func (l *Logger) LogRequest(e RequestLog) {
+	if logLevelRank["info"] < logLevelRank[l.level] {
+		return
+	}
+	if l.format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{
+			"time":       time.Now().Format(time.RFC3339),
+			"level":      "info",
+			"msg":        "proxied request",
+			"requestId":  e.RequestID,
+			"backend":    e.Backend,
+			"method":     e.Method,
+			"path":       e.Path,
+			"target":     e.Target,
+			"status":     e.Status,
+			"bytes":      e.Bytes,
+			"durationMs": e.Duration.Milliseconds(),
+		})
+		fmt.Fprintln(os.Stdout, string(data))
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s [INFO] %s %s target=%s status=%d bytes=%d duration=%s request_id=%s\n",
+		time.Now().Format(time.RFC3339), e.Method, e.Path, e.Target, e.Status, e.Bytes, e.Duration, e.RequestID)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// connectionByID looks up a connection by its store ID.
+func connectionByID(store *ConnectionStore, id string) (CLIConnection, bool) {
+	for _, c := range store.List() {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return CLIConnection{}, false
+}
+
+// ── POST /api/v1/write ───────────────────────────────────────────────────────
+
+// WriteSample is one row of the JSON form accepted by /api/v1/write, as an
+// alternative to raw InfluxDB line protocol.
+type WriteSample struct {
+	Measurement string             `json:"measurement"`
+	Tags        map[string]string  `json:"tags,omitempty"`
+	Fields      map[string]float64 `json:"fields"`
+	Timestamp   int64              `json:"timestamp,omitempty"` // unix nanoseconds; upstream defaults to now() if zero
+}
+
+// makeRemoteWriteHandler accepts InfluxDB line protocol (or JSON samples)
+// and fans it out to the connection named by the ?connection= query
+// parameter (its store ID): InfluxDB v1 /write, InfluxDB v2 /api/v2/write
+// (chosen when ?org=&bucket= are given; Token auth from the connection's
+// password), or a VictoriaMetrics /api/v1/import/prometheus target.
+func makeRemoteWriteHandler(httpClient *http.Client, store *ConnectionStore, resilience *ResilienceRegistry, disableWrite bool, maxResponseSize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if disableWrite {
+			jsonError(w, http.StatusForbidden, "Write Data is disabled")
+			return
+		}
+		if r.Method != http.MethodPost {
+			jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		conn, ok := connectionByID(store, r.URL.Query().Get("connection"))
+		if !ok {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("Unknown connection %q", r.URL.Query().Get("connection")))
+			return
+		}
+
+		lineProtocol, err := readWriteBody(r, maxResponseSize)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("Invalid write payload: %s", err))
+			return
+		}
+
+		proxyReq, err := buildUpstreamWriteRequest(r, conn, lineProtocol)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		resp, err := resilience.Do(httpClient, "write", proxyReq)
+		if err != nil {
+			writeResilienceError(w, err, resilience, "write", proxyReq.URL.Hostname())
+			return
+		}
+		defer resp.Body.Close()
+		writeProxiedResponse(w, r, resp, maxResponseSize)
+	}
+}
+
+// readWriteBody returns the request body as InfluxDB line protocol,
+// converting it from JSON samples first if Content-Type asks for it. The
+// body is capped at maxBytes, the same --max-response-size limit enforced
+// on proxied upstream responses, so a single POST can't exhaust memory.
+func readWriteBody(r *http.Request, maxBytes int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("request body exceeds the %d byte limit", maxBytes)
+	}
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		return body, nil
+	}
+	var samples []WriteSample
+	if err := json.Unmarshal(body, &samples); err != nil {
+		return nil, fmt.Errorf("parsing JSON samples: %w", err)
+	}
+	return samplesToLineProtocol(samples)
+}
+
+// lpSpecialChars escapes the characters line protocol requires a backslash
+// before wherever they appear in a measurement, tag key/value, or field key:
+// https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/#special-characters
+var lpSpecialChars = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+
+func samplesToLineProtocol(samples []WriteSample) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, s := range samples {
+		if len(s.Fields) == 0 {
+			return nil, fmt.Errorf("sample for measurement %q has no fields", s.Measurement)
+		}
+		buf.WriteString(lpSpecialChars.Replace(s.Measurement))
+		for k, v := range s.Tags {
+			fmt.Fprintf(&buf, ",%s=%s", lpSpecialChars.Replace(k), lpSpecialChars.Replace(v))
+		}
+		buf.WriteByte(' ')
+		first := true
+		for k, v := range s.Fields {
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			fmt.Fprintf(&buf, "%s=%s", lpSpecialChars.Replace(k), strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		if s.Timestamp != 0 {
+			fmt.Fprintf(&buf, " %d", s.Timestamp)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// buildUpstreamWriteRequest picks the wire format for conn's backend type
+// and builds the outbound request carrying lineProtocol as its body.
+func buildUpstreamWriteRequest(r *http.Request, conn CLIConnection, lineProtocol []byte) (*http.Request, error) {
+	switch conn.Type {
+	case "influxdb":
+		return buildInfluxWriteRequest(r, conn, lineProtocol)
+	case "victoriametrics":
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodPost,
+			strings.TrimRight(conn.URL, "/")+"/api/v1/import/prometheus", bytes.NewReader(lineProtocol))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if conn.Username != "" || conn.Password != "" {
+			req.SetBasicAuth(conn.Username, conn.Password)
+		}
+		return req, nil
+	default:
+		return nil, fmt.Errorf("writes are not supported for connection type %q", conn.Type)
+	}
+}
+
+func buildInfluxWriteRequest(r *http.Request, conn CLIConnection, lineProtocol []byte) (*http.Request, error) {
+	org := r.URL.Query().Get("org")
+	bucket := r.URL.Query().Get("bucket")
+	if org != "" || bucket != "" {
+		if org == "" || bucket == "" {
+			return nil, fmt.Errorf("InfluxDB v2 writes require both org and bucket")
+		}
+		u := fmt.Sprintf("%s/api/v2/write?%s", strings.TrimRight(conn.URL, "/"),
+			url.Values{"org": {org}, "bucket": {bucket}}.Encode())
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, u, bytes.NewReader(lineProtocol))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if conn.Password != "" {
+			req.Header.Set("Authorization", "Token "+conn.Password)
+		}
+		return req, nil
+	}
+
+	database := r.URL.Query().Get("database")
+	if database == "" {
+		database = conn.DefaultDatabase
+	}
+	q := url.Values{"db": {database}}
+	if conn.Username != "" {
+		q.Set("u", conn.Username)
+	}
+	if conn.Password != "" {
+		q.Set("p", conn.Password)
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost,
+		strings.TrimRight(conn.URL, "/")+"/write?"+q.Encode(), bytes.NewReader(lineProtocol))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return req, nil
+}
+
+// ── POST /api/v1/read ────────────────────────────────────────────────────────
+
+// ReadAPIRequest is the JSON body accepted by /api/v1/read: a metric name,
+// optional extra label matchers (all equality), and a millisecond time
+// range.
+type ReadAPIRequest struct {
+	Connection string            `json:"connection"`
+	Query      string            `json:"query"`
+	Matchers   map[string]string `json:"matchers,omitempty"`
+	Start      int64             `json:"start"`
+	End        int64             `json:"end"`
+}
+
+// ReadAPISeries is one series of the JSON time-series shape returned by
+// /api/v1/read, uniform across Prometheus and VictoriaMetrics connections.
+type ReadAPISeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][2]float64      `json:"values"` // [unixSeconds, value]
+}
+
+// makeRemoteReadHandler speaks the Prometheus remote_read protocol
+// (snappy block-compressed protobuf) to the connection named by the request body,
+// decoding the response into JSON the UI can render without its own
+// protobuf client.
+func makeRemoteReadHandler(httpClient *http.Client, store *ConnectionStore, resilience *ResilienceRegistry, maxResponseSize int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodPost {
+			jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var req ReadAPIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %s", err))
+			return
+		}
+		if req.Query == "" || req.Start == 0 || req.End == 0 {
+			jsonError(w, http.StatusBadRequest, "query, start, and end are required")
+			return
+		}
+
+		conn, ok := connectionByID(store, req.Connection)
+		if !ok {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("Unknown connection %q", req.Connection))
+			return
+		}
+		if conn.Type != "prometheus" && conn.Type != "victoriametrics" {
+			jsonError(w, http.StatusBadRequest, "remote_read is only supported for prometheus and victoriametrics connections")
+			return
+		}
+
+		matchers := []*prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: "__name__", Value: req.Query},
+		}
+		for name, value := range req.Matchers {
+			matchers = append(matchers, &prompb.LabelMatcher{Type: prompb.LabelMatcher_EQ, Name: name, Value: value})
+		}
+
+		readReq := &prompb.ReadRequest{
+			Queries: []*prompb.Query{{
+				StartTimestampMs: req.Start,
+				EndTimestampMs:   req.End,
+				Matchers:         matchers,
+			}},
+		}
+		data, err := readReq.Marshal()
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to encode remote_read request: %s", err))
+			return
+		}
+
+		proxyReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost,
+			strings.TrimRight(conn.URL, "/")+"/api/v1/read", bytes.NewReader(snappy.Encode(nil, data)))
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create request: %s", err))
+			return
+		}
+		proxyReq.Header.Set("Content-Type", "application/x-protobuf")
+		proxyReq.Header.Set("Content-Encoding", "snappy")
+		proxyReq.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+		if conn.Username != "" || conn.Password != "" {
+			proxyReq.SetBasicAuth(conn.Username, conn.Password)
+		}
+
+		resp, err := resilience.Do(httpClient, "read", proxyReq)
+		if err != nil {
+			writeResilienceError(w, err, resilience, "read", proxyReq.URL.Hostname())
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			jsonError(w, resp.StatusCode, fmt.Sprintf("Upstream remote_read returned %s", resp.Status))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+		if err != nil {
+			jsonError(w, http.StatusBadGateway, fmt.Sprintf("Failed to read upstream response: %s", err))
+			return
+		}
+		if int64(len(body)) > maxResponseSize {
+			jsonError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upstream response exceeds the %d byte limit", maxResponseSize))
+			return
+		}
+		decoded, err := snappy.Decode(nil, body)
+		if err != nil {
+			jsonError(w, http.StatusBadGateway, fmt.Sprintf("Failed to decode remote_read response: %s", err))
+			return
+		}
+		var readResp prompb.ReadResponse
+		if err := readResp.Unmarshal(decoded); err != nil {
+			jsonError(w, http.StatusBadGateway, fmt.Sprintf("Failed to parse remote_read response: %s", err))
+			return
+		}
+
+		series := []ReadAPISeries{}
+		for _, result := range readResp.Results {
+			for _, ts := range result.Timeseries {
+				metric := make(map[string]string, len(ts.Labels))
+				for _, l := range ts.Labels {
+					metric[l.Name] = l.Value
+				}
+				values := make([][2]float64, 0, len(ts.Samples))
+				for _, s := range ts.Samples {
+					values = append(values, [2]float64{float64(s.Timestamp) / 1000, s.Value})
+				}
+				series = append(series, ReadAPISeries{Metric: metric, Values: values})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(series)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen and errRateLimited are returned by ResilienceRegistry.Do
+// instead of performing the request; callers translate them into a 503 or
+// 429 response respectively.
+var (
+	errCircuitOpen = errors.New("circuit breaker open")
+	errRateLimited = errors.New("rate limit exceeded")
+)
+
+const (
+	breakerFailureThreshold = 5
+	breakerWindow           = 30 * time.Second
+	breakerCooldown         = 30 * time.Second
+	proxyMaxRetryAttempts   = 3
+)
+
+// ResilienceRegistry holds the per-(backend, target-host) circuit breakers
+// and rate limiters guarding outbound proxy calls. A single registry is
+// shared across all proxy handlers for the life of the process.
+type ResilienceRegistry struct {
+	rps   float64
+	burst float64
+
+	breakers sync.Map // string -> *circuitBreaker
+	limiters sync.Map // string -> *tokenBucket
+}
+
+// NewResilienceRegistry builds a registry. rps <= 0 disables rate limiting
+// entirely (circuit breaking and retries still apply).
+func NewResilienceRegistry(rps float64, burst float64) *ResilienceRegistry {
+	return &ResilienceRegistry{rps: rps, burst: burst}
+}
+
+func targetKey(backend, host string) string {
+	return backend + "|" + host
+}
+
+func (r *ResilienceRegistry) breakerFor(key string) *circuitBreaker {
+	v, _ := r.breakers.LoadOrStore(key, newCircuitBreaker())
+	return v.(*circuitBreaker)
+}
+
+func (r *ResilienceRegistry) limiterFor(key string) *tokenBucket {
+	v, _ := r.limiters.LoadOrStore(key, newTokenBucket(r.rps, r.burst))
+	return v.(*tokenBucket)
+}
+
+// Do executes req against httpClient, guarded by the target's rate limiter
+// and circuit breaker. GET/HEAD requests are retried with jittered
+// exponential backoff on network errors or 502/503/504 responses;
+// non-idempotent methods are attempted once.
+func (r *ResilienceRegistry) Do(httpClient *http.Client, backend string, req *http.Request) (*http.Response, error) {
+	key := targetKey(backend, req.URL.Hostname())
+	breaker := r.breakerFor(key)
+	if !breaker.Allow() {
+		return nil, errCircuitOpen
+	}
+	if r.rps > 0 && !r.limiterFor(key).Allow() {
+		return nil, errRateLimited
+	}
+
+	maxAttempts := 1
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		maxAttempts = proxyMaxRetryAttempts
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		resp, err = httpClient.Do(req)
+		if err == nil && !isRetryableStatus(resp.StatusCode) {
+			if resp.StatusCode >= 500 {
+				breaker.RecordFailure(fmt.Sprintf("upstream status %d", resp.StatusCode))
+			} else {
+				breaker.RecordSuccess()
+			}
+			return resp, nil
+		}
+		if attempt == maxAttempts-1 {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+			resp = nil
+		}
+		time.Sleep(jitteredBackoff(attempt))
+	}
+
+	if err != nil {
+		breaker.RecordFailure(err.Error())
+		return nil, err
+	}
+	breaker.RecordFailure(fmt.Sprintf("upstream status %d", resp.StatusCode))
+	return resp, nil
+}
+
+// RetryAfterSeconds reports how long a circuit-open response for this
+// target should ask the client to wait before retrying.
+func (r *ResilienceRegistry) RetryAfterSeconds(backend, host string) int {
+	return r.breakerFor(targetKey(backend, host)).Snapshot().RetryAfterSeconds
+}
+
+// ProxyTargetState is the JSON shape reported at /api/v1/proxy/state.
+type ProxyTargetState struct {
+	Backend           string `json:"backend"`
+	Target            string `json:"target"`
+	State             string `json:"state"`
+	ConsecutiveErrors int    `json:"consecutiveErrors"`
+	LastError         string `json:"lastError,omitempty"`
+	RetryAfterSeconds int    `json:"retryAfterSeconds,omitempty"`
+}
+
+// Snapshot reports the current state of every target the registry has seen.
+func (r *ResilienceRegistry) Snapshot() []ProxyTargetState {
+	out := []ProxyTargetState{}
+	r.breakers.Range(func(k, v interface{}) bool {
+		backend, target, _ := strings.Cut(k.(string), "|")
+		snap := v.(*circuitBreaker).Snapshot()
+		out = append(out, ProxyTargetState{
+			Backend:           backend,
+			Target:            target,
+			State:             snap.State,
+			ConsecutiveErrors: snap.ConsecutiveErrors,
+			LastError:         snap.LastError,
+			RetryAfterSeconds: snap.RetryAfterSeconds,
+		})
+		return true
+	})
+	return out
+}
+
+// writeResilienceError translates a ResilienceRegistry.Do error into the
+// appropriate HTTP response: 503 + Retry-After for an open circuit, 429 for
+// a rate-limited target, 502 for anything else (a genuine connection
+// failure after exhausting retries).
+func writeResilienceError(w http.ResponseWriter, err error, resilience *ResilienceRegistry, backend, host string) {
+	switch {
+	case errors.Is(err, errCircuitOpen):
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", resilience.RetryAfterSeconds(backend, host)))
+		jsonError(w, http.StatusServiceUnavailable, fmt.Sprintf("Circuit breaker open for %s; backing off", host))
+	case errors.Is(err, errRateLimited):
+		jsonError(w, http.StatusTooManyRequests, fmt.Sprintf("Rate limit exceeded for %s", host))
+	default:
+		jsonError(w, http.StatusBadGateway, fmt.Sprintf("Connection failed: %s", err))
+	}
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+func jitteredBackoff(attempt int) time.Duration {
+	base := 100 * time.Millisecond << attempt
+	return base + time.Duration(rand.Int63n(int64(base)))
+}
+
+// ── Token-bucket rate limiter ────────────────────────────────────────────────
+
+// tokenBucket is a simple token-bucket limiter: rate tokens/sec refill up to
+// a burst capacity; each allowed request consumes one token.
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	rate   float64
+	burst  float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{tokens: burst, rate: rate, burst: burst, last: time.Now()}
+}
+
+func (t *tokenBucket) Allow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.burst {
+		t.tokens = t.burst
+	}
+	t.last = now
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+// ── Circuit breaker ──────────────────────────────────────────────────────────
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker opens after breakerFailureThreshold consecutive 5xx/timeout
+// results within breakerWindow, short-circuiting further calls until
+// breakerCooldown elapses. It then turns half-open: every request is let
+// through (the number of trial requests is not limited) and the next
+// recorded result closes it (success) or reopens it (failure).
+type circuitBreaker struct {
+	mu          sync.Mutex
+	state       breakerState
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	lastError   string
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{state: breakerClosed}
+}
+
+// Allow reports whether a request may proceed, transitioning an open
+// breaker to half-open once its cooldown has elapsed.
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerOpen {
+		return true
+	}
+	if time.Since(b.openedAt) < breakerCooldown {
+		return false
+	}
+	b.state = breakerHalfOpen
+	return true
+}
+
+func (b *circuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.lastError = ""
+}
+
+func (b *circuitBreaker) RecordFailure(errMsg string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastError = errMsg
+	now := time.Now()
+
+	if b.state == breakerHalfOpen {
+		b.open(now)
+		return
+	}
+	if b.windowStart.IsZero() || now.Sub(b.windowStart) > breakerWindow {
+		b.windowStart = now
+		b.failures = 0
+	}
+	b.failures++
+	if b.failures >= breakerFailureThreshold {
+		b.open(now)
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	b.state = breakerOpen
+	b.openedAt = now
+}
+
+// breakerSnapshot is a point-in-time, lock-free view of a breaker's state.
+type breakerSnapshot struct {
+	State             string
+	ConsecutiveErrors int
+	LastError         string
+	RetryAfterSeconds int
+}
+
+func (b *circuitBreaker) Snapshot() breakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	retryAfter := 0
+	if b.state == breakerOpen {
+		if remaining := breakerCooldown - time.Since(b.openedAt); remaining > 0 {
+			retryAfter = int(remaining.Seconds()) + 1
+		}
+	}
+	return breakerSnapshot{
+		State:             b.state.String(),
+		ConsecutiveErrors: b.failures,
+		LastError:         b.lastError,
+		RetryAfterSeconds: retryAfter,
+	}
+}